@@ -1,20 +1,28 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"os"
+	"time"
 
+	"github.com/ivar1309/Handradi/internal/config"
 	"github.com/ivar1309/Handradi/internal/db"
 )
 
 func main() {
 	if len(os.Args) < 2 {
-		fmt.Println("Usage: cli [add|list|delete] ...")
+		fmt.Println("Usage: cli [add|list|delete|key] ...")
 		return
 	}
 
-	db.InitDB()
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db.InitDB(cfg.DBPath)
 	defer db.Close()
 
 	cmd := os.Args[1]
@@ -56,7 +64,71 @@ func main() {
 		}
 		fmt.Println("🗑️ Client deleted:", clientID)
 
+	case "key":
+		runKeyCommand(os.Args[2:])
+
 	default:
 		fmt.Println("Unknown command:", cmd)
 	}
 }
+
+func runKeyCommand(args []string) {
+	if len(args) < 1 {
+		fmt.Println("Usage: cli key [create|revoke] ...")
+		return
+	}
+
+	switch args[0] {
+	case "create":
+		runKeyCreate(args[1:])
+	case "revoke":
+		runKeyRevoke(args[1:])
+	default:
+		fmt.Println("Unknown key subcommand:", args[0])
+	}
+}
+
+func runKeyCreate(args []string) {
+	fs := flag.NewFlagSet("key create", flag.ExitOnError)
+	client := fs.String("client", "", "client id to derive the key for")
+	scopesFlag := fs.String("scopes", "", "comma-separated scopes: upload,download,delete,list,presign (download is accepted but unenforced: /download is always public)")
+	prefix := fs.String("prefix", "", "key prefix the new key is restricted to")
+	expires := fs.Duration("expires", 0, "how long the key is valid for (e.g. 24h), 0 for never")
+	parent := fs.String("parent", "", "api key to derive this key from; the new key's scopes and prefix must fall within the parent's, and revoking the parent revokes it too")
+	fs.Parse(args)
+
+	if *client == "" || *scopesFlag == "" {
+		fmt.Println("Usage: cli key create --client=<client_id> --scopes=upload,list [--prefix=uploads/] [--expires=24h] [--parent=<api_key>]")
+		return
+	}
+
+	scopes, err := db.ParseScopes(*scopesFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var expiresAt time.Time
+	if *expires > 0 {
+		expiresAt = time.Now().Add(*expires)
+	}
+
+	apiKey, err := db.CreateScopedKey(*client, *parent, scopes, *prefix, expiresAt)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println("✅ Key created:", apiKey)
+}
+
+func runKeyRevoke(args []string) {
+	if len(args) != 1 {
+		fmt.Println("Usage: cli key revoke <api_key>")
+		return
+	}
+
+	if err := db.RevokeKey(args[0]); err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println("🗑️ Key revoked:", args[0])
+}
@@ -1,15 +1,21 @@
 package main
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
+	"mime/multipart"
 	"net/http"
-	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -17,15 +23,55 @@ import (
 
 	"github.com/disintegration/imaging"
 	"github.com/gabriel-vasile/mimetype"
+	"github.com/ivar1309/Handradi/internal/backends"
+	"github.com/ivar1309/Handradi/internal/backends/localfs"
+	"github.com/ivar1309/Handradi/internal/backends/s3"
+	"github.com/ivar1309/Handradi/internal/config"
 	"github.com/ivar1309/Handradi/internal/db"
+	"github.com/ivar1309/Handradi/internal/httputil"
+	"github.com/ivar1309/Handradi/internal/metadata"
 )
 
+const sweepInterval = 10 * time.Minute
+
 var (
-	storageRoot = "./storage"
+	cfg     *config.Config
+	storage backends.StorageBackend
 )
 
-// Middleware: API Key + CORS
-func withAuthAndCORS(next http.Handler) http.Handler {
+// newStorageBackend selects a StorageBackend based on cfg.Backend ("s3" or
+// "localfs", defaulting to "localfs").
+func newStorageBackend(cfg *config.Config) (backends.StorageBackend, error) {
+	switch cfg.Backend {
+	case "s3":
+		return s3.New(s3.ConfigFromEnv())
+	case "", "localfs":
+		return localfs.New(cfg.StorageRoot), nil
+	default:
+		return nil, fmt.Errorf("unknown backend %q", cfg.Backend)
+	}
+}
+
+// objectKey joins a client and filename into the key a StorageBackend
+// stores an object under.
+func objectKey(client, filename string) string {
+	return client + "/" + filename
+}
+
+type contextKey int
+
+const permissionsContextKey contextKey = 0
+
+// permissionsFromContext returns the *db.Permissions that withAuthAndCORS
+// attached to the request, if any.
+func permissionsFromContext(r *http.Request) *db.Permissions {
+	perm, _ := r.Context().Value(permissionsContextKey).(*db.Permissions)
+	return perm
+}
+
+// Middleware: API Key + CORS. op is the operation this route performs;
+// the caller's key must be scoped to allow it.
+func withAuthAndCORS(op db.Operation, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		clientID := sanitizeClient(r.URL.Query().Get("client"))
 		apiKey := r.Header.Get("x-api-key")
@@ -35,15 +81,19 @@ func withAuthAndCORS(next http.Handler) http.Handler {
 			return
 		}
 
-		allowedOrigin, err := db.CheckAuth(clientID, apiKey)
-
+		perm, err := db.CheckAuth(clientID, apiKey)
 		if err != nil {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
+		if !perm.Allows(op) {
+			http.Error(w, "Forbidden: key does not allow this operation", http.StatusForbidden)
+			return
+		}
+
 		// Set dynamic CORS headers
-		w.Header().Set("Access-Control-Allow-Origin", allowedOrigin)
+		w.Header().Set("Access-Control-Allow-Origin", perm.AllowedOrigin)
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, x-api-key")
 
@@ -52,10 +102,43 @@ func withAuthAndCORS(next http.Handler) http.Handler {
 			return
 		}
 
+		r = r.WithContext(context.WithValue(r.Context(), permissionsContextKey, perm))
 		next.ServeHTTP(w, r)
 	})
 }
 
+// Middleware: API key OR per-file delete key, + CORS. Used by /delete so a
+// caller holding only a file's delete_key can remove it without the
+// client's all-powerful API key.
+func withDeleteAuthAndCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientID := sanitizeClient(r.URL.Query().Get("client"))
+		filename := filepath.Base(r.URL.Query().Get("filename"))
+
+		if deleteKey := r.Header.Get("x-delete-key"); deleteKey != "" {
+			m, err := metadata.Load(storage, objectKey(clientID, filename))
+			if err != nil || m.DeleteKey == "" || m.DeleteKey != deleteKey {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+			w.Header().Set("Access-Control-Allow-Methods", "DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, x-delete-key")
+
+			if r.Method == http.MethodOptions {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		withAuthAndCORS(db.OpDelete, next).ServeHTTP(w, r)
+	})
+}
+
 // Middleware: Public CORS
 func withPublicCORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -96,43 +179,250 @@ func uploadHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	dir := filepath.Join(storageRoot, client)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		http.Error(w, "Cannot create storage dir: "+err.Error(), http.StatusInternalServerError)
+	key := objectKey(client, filename)
+	if perm := permissionsFromContext(r); perm != nil && !perm.AllowsKey(key) {
+		http.Error(w, "Forbidden: key does not allow this path", http.StatusForbidden)
 		return
 	}
 
-	fileContent, err := io.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, "could not read body", http.StatusBadRequest)
+	body, mime, ok := sniffBody(w, r)
+	if !ok {
 		return
 	}
 
-	filePath, err := saveFile(dir, filename, fileContent)
-	if err != nil {
+	hash := sha256.New()
+	counting := &countingReader{r: io.TeeReader(body, hash)}
+	if err := storage.Put(key, counting); err != nil {
 		http.Error(w, "Cannot create file: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("Upload: %v to %v", filename, dir)
+	deleteKey, err := metadata.NewDeleteKey()
+	if err != nil {
+		http.Error(w, "Cannot generate delete key: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	m := metadata.Metadata{
+		DeleteKey:      deleteKey,
+		SHA256Sum:      hex.EncodeToString(hash.Sum(nil)),
+		MimeType:       mime.String(),
+		Size:           counting.n,
+		ExpiryUnix:     expiryFromQuery(r),
+		OriginalName:   filename,
+		UploaderClient: client,
+	}
+	if err := metadata.Save(storage, key, m); err != nil {
+		http.Error(w, "Cannot save metadata: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Upload: %v to %v", filename, client)
 
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	fmt.Fprintf(w, `{"message":"uploaded","path":"%s"}`, filePath)
+	json.NewEncoder(w).Encode(m)
+}
+
+// pomfFile is one entry in a pomf-compatible upload response.
+type pomfFile struct {
+	URL  string `json:"url"`
+	Name string `json:"name"`
+	Hash string `json:"hash"`
+	Size int64  `json:"size"`
+}
+
+type pomfSuccessResponse struct {
+	Success bool       `json:"success"`
+	Files   []pomfFile `json:"files"`
+}
+
+type pomfErrorResponse struct {
+	Success     bool   `json:"success"`
+	ErrorCode   int    `json:"errorcode"`
+	Description string `json:"description"`
+}
+
+func writePomfError(w http.ResponseWriter, status, errorcode int, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(pomfErrorResponse{
+		Success:     false,
+		ErrorCode:   errorcode,
+		Description: description,
+	})
+}
+
+// pomfUploadHandler accepts a multipart/form-data POST with one or more
+// "files[]" parts and responds in the format pomf/uguu-style clients
+// expect: {"success":true,"files":[{"url","name","hash","size"}...]}.
+func pomfUploadHandler(w http.ResponseWriter, r *http.Request) {
+	client := sanitizeClient(r.URL.Query().Get("client"))
+	if client == "" {
+		writePomfError(w, http.StatusBadRequest, 1, "client required")
+		return
+	}
+
+	if cfg.MaxUploadBytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, cfg.MaxUploadBytes)
+	}
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		writePomfError(w, http.StatusBadRequest, 2, "Could not parse multipart form: "+err.Error())
+		return
+	}
+
+	var files []pomfFile
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			writePomfError(w, http.StatusBadRequest, 2, "Could not read multipart form: "+err.Error())
+			return
+		}
+
+		if part.FormName() != "files[]" && part.FileName() == "" {
+			part.Close()
+			continue
+		}
+
+		file, err := savePomfPart(client, part, r)
+		part.Close()
+		if err != nil {
+			writePomfError(w, http.StatusUnsupportedMediaType, 3, err.Error())
+			return
+		}
+
+		files = append(files, file)
+	}
+
+	if len(files) == 0 {
+		writePomfError(w, http.StatusBadRequest, 4, "no files uploaded")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pomfSuccessResponse{Success: true, Files: files})
 }
 
-func saveFile(dir string, filename string, content []byte) (string, error) {
-	filePath := filepath.Join(dir, filename)
-	out, err := os.Create(filePath)
+// savePomfPart stores a single multipart part through the storage backend,
+// enforcing cfg.AllowedMIMETypes and generating a random filename when the
+// part doesn't supply one.
+func savePomfPart(client string, part *multipart.Part, r *http.Request) (pomfFile, error) {
+	filename := filepath.Base(part.FileName())
+	if filename == "" || filename == "." {
+		name, err := metadata.NewDeleteKey()
+		if err != nil {
+			return pomfFile{}, err
+		}
+		filename = name[:8]
+	}
+
+	peek := make([]byte, 512)
+	n, _ := io.ReadFull(part, peek)
+	peek = peek[:n]
+
+	mime := mimetype.Detect(peek)
+	if !mimeAllowed(mime.String(), cfg.AllowedMIMETypes) {
+		return pomfFile{}, fmt.Errorf("mime type %s not allowed", mime.String())
+	}
+
+	key := objectKey(client, filename)
+	hash := sha256.New()
+	body := io.MultiReader(bytes.NewReader(peek), part)
+	counting := &countingReader{r: io.TeeReader(body, hash)}
+	if err := storage.Put(key, counting); err != nil {
+		return pomfFile{}, err
+	}
+
+	deleteKey, err := metadata.NewDeleteKey()
 	if err != nil {
-		return "", err
+		return pomfFile{}, err
+	}
+
+	m := metadata.Metadata{
+		DeleteKey:      deleteKey,
+		SHA256Sum:      hex.EncodeToString(hash.Sum(nil)),
+		MimeType:       mime.String(),
+		Size:           counting.n,
+		ExpiryUnix:     expiryFromQuery(r),
+		OriginalName:   part.FileName(),
+		UploaderClient: client,
+	}
+	if err := metadata.Save(storage, key, m); err != nil {
+		return pomfFile{}, err
+	}
+
+	log.Printf("Upload: %v to %v (pomf)", filename, client)
+
+	return pomfFile{
+		URL:  fmt.Sprintf("/download?client=%s&filename=%s", client, filename),
+		Name: filename,
+		Hash: m.SHA256Sum,
+		Size: m.Size,
+	}, nil
+}
+
+// sniffBody applies cfg.MaxUploadBytes to r.Body and sniffs its MIME type
+// from the first 512 bytes, rejecting it under cfg.AllowedMIMETypes. On
+// success it writes nothing and returns a reader with those bytes reattached
+// to the front of r.Body; on rejection it writes the HTTP error itself and
+// returns ok=false.
+func sniffBody(w http.ResponseWriter, r *http.Request) (body io.Reader, mime *mimetype.MIME, ok bool) {
+	if cfg.MaxUploadBytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, cfg.MaxUploadBytes)
+	}
+
+	peek := make([]byte, 512)
+	n, _ := io.ReadFull(r.Body, peek)
+	peek = peek[:n]
+
+	mime = mimetype.Detect(peek)
+	if !mimeAllowed(mime.String(), cfg.AllowedMIMETypes) {
+		http.Error(w, fmt.Sprintf("mime type %s not allowed", mime.String()), http.StatusUnsupportedMediaType)
+		return nil, nil, false
+	}
+
+	return io.MultiReader(bytes.NewReader(peek), r.Body), mime, true
+}
+
+// mimeAllowed reports whether mime is acceptable under allowed. An empty
+// allow-list means every mime type is accepted.
+func mimeAllowed(mime string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, a := range allowed {
+		if strings.EqualFold(strings.TrimSpace(a), mime) {
+			return true
+		}
 	}
-	defer out.Close()
+	return false
+}
 
-	if _, err := out.Write(content); err != nil {
-		return "", err
+// expiryFromQuery reads the "expires" query param (seconds from now, or 0
+// for never) and returns the resulting absolute expiry unix timestamp.
+func expiryFromQuery(r *http.Request) int64 {
+	seconds, err := strconv.ParseInt(r.URL.Query().Get("expires"), 10, 64)
+	if err != nil || seconds <= 0 {
+		return 0
 	}
+	return time.Now().Add(time.Duration(seconds) * time.Second).Unix()
+}
+
+// countingReader wraps an io.Reader, tracking the number of bytes read.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
 
-	return filePath, nil
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
 }
 
 // Download + optional resize
@@ -145,23 +435,19 @@ func downloadHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	filePath := filepath.Join(storageRoot, client, filename)
+	if metadata.IsSidecarKey(filename) {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
 
-	// Detect mime
-	mime, _ := mimetype.DetectFile(filePath)
-	w.Header().Set("Content-Type", mime.String())
+	key := objectKey(client, filename)
+	m, metaErr := metadata.Load(storage, key)
 
 	// Optional resizing: /download?...&width=300&height=200
 	widthStr := r.URL.Query().Get("width")
 	heightStr := r.URL.Query().Get("height")
 
 	if widthStr != "" || heightStr != "" {
-		img, err := imaging.Open(filePath)
-		if err != nil {
-			http.Error(w, "Cannot open image: "+err.Error(), http.StatusInternalServerError)
-			return
-		}
-
 		width := 0
 		height := 0
 		if widthStr != "" {
@@ -171,18 +457,142 @@ func downloadHandler(w http.ResponseWriter, r *http.Request) {
 			fmt.Sscanf(heightStr, "%d", &height)
 		}
 
-		resized := imaging.Resize(img, width, height, imaging.Lanczos)
-		w.Header().Set("Content-Type", "image/png")
-		imaging.Encode(w, resized, imaging.PNG)
+		serveThumbnail(w, r, key, filename, m, width, height)
+		return
+	}
 
-		log.Printf("Download: %v in changed dimensions -> %vx%v", filename, width, height)
+	if m.MimeType != "" {
+		w.Header().Set("Content-Type", m.MimeType)
+	}
 
+	rc, meta, err := storage.Get(key)
+	if err != nil {
+		http.Error(w, "Cannot open file: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	sha := m.SHA256Sum
+	if metaErr != nil {
+		sha = ""
+	}
+
 	log.Printf("Download: %v in original dimensions", filename)
 
-	http.ServeFile(w, r, filePath)
+	httputil.ServeContent(w, r, filename, meta.ModTime, sha, rc)
+}
+
+// thumbAlgo names the resampling algorithm baked into thumbnail cache keys,
+// so changing it invalidates previously cached thumbnails.
+const thumbAlgo = "lanczos"
+
+// thumbsPrefix namespaces cached thumbnails in the same key-space as
+// "<client>/<filename>" objects. It leads with a dot so that it can never
+// collide with a real client directory: sanitizeClient strips every
+// character outside [a-zA-Z0-9_-], so no client ID can ever be ".thumbs".
+const thumbsPrefix = ".thumbs/"
+
+// thumbnailTTL bounds how long a cached thumbnail is kept once its source
+// file is gone. Thumbnails have no sidecar of their own (and thus no
+// association with the source's expiry), so runExpirySweeper evicts them
+// purely by age instead.
+const thumbnailTTL = 24 * time.Hour
+
+// thumbnailCacheKey returns the storage key a resized copy of originalSHA is
+// cached under for the given dimensions, and the hash that names it.
+func thumbnailCacheKey(originalSHA string, width, height int) (key, hash string) {
+	h := sha256.Sum256([]byte(fmt.Sprintf("%s|%dx%d|%s", originalSHA, width, height, thumbAlgo)))
+	hash = hex.EncodeToString(h[:])
+	return fmt.Sprintf("%s%s.png", thumbsPrefix, hash), hash
+}
+
+// sweepThumbnails deletes cached thumbnails older than thumbnailTTL. It runs
+// independently of metadata.Sweep since thumbnails carry no sidecar and
+// aren't reachable from any client's key prefix.
+func sweepThumbnails(storage backends.StorageBackend, now time.Time) (int, error) {
+	names, err := storage.List(thumbsPrefix)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, name := range names {
+		key := thumbsPrefix + name
+		rc, meta, err := storage.Get(key)
+		if err != nil {
+			continue
+		}
+		rc.Close()
+
+		if now.Sub(meta.ModTime) < thumbnailTTL {
+			continue
+		}
+
+		if err := storage.Delete(key); err != nil {
+			continue
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// serveThumbnail serves a width x height PNG resize of key, computing and
+// caching it on first request and serving the cached copy (through the
+// same conditional/Range path as the original) on subsequent ones. When
+// m has no SHA256Sum (missing or not-yet-written sidecar), caching is
+// skipped entirely rather than keying on an empty hash, which would let
+// unrelated files collide on the same cache entry.
+func serveThumbnail(w http.ResponseWriter, r *http.Request, key, filename string, m metadata.Metadata, width, height int) {
+	if m.SHA256Sum == "" {
+		renderThumbnail(w, r, key, filename, "", "", width, height)
+		return
+	}
+
+	cacheKey, hash := thumbnailCacheKey(m.SHA256Sum, width, height)
+
+	if rc, meta, err := storage.Get(cacheKey); err == nil {
+		w.Header().Set("Content-Type", "image/png")
+		httputil.ServeContent(w, r, filename+".png", meta.ModTime, hash, rc)
+		return
+	}
+
+	renderThumbnail(w, r, key, filename, cacheKey, hash, width, height)
+}
+
+// renderThumbnail decodes key, resizes it to width x height and serves the
+// result. If cacheKey is non-empty, the resized PNG is also stored under it
+// (named by hash) for serveThumbnail to reuse on the next request.
+func renderThumbnail(w http.ResponseWriter, r *http.Request, key, filename, cacheKey, hash string, width, height int) {
+	rc, _, err := storage.Get(key)
+	if err != nil {
+		http.Error(w, "Cannot open image: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	img, err := imaging.Decode(rc)
+	rc.Close()
+	if err != nil {
+		http.Error(w, "Cannot open image: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resized := imaging.Resize(img, width, height, imaging.Lanczos)
+
+	var buf bytes.Buffer
+	if err := imaging.Encode(&buf, resized, imaging.PNG); err != nil {
+		http.Error(w, "Cannot encode image: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if cacheKey != "" {
+		if err := storage.Put(cacheKey, bytes.NewReader(buf.Bytes())); err != nil {
+			log.Printf("Thumbnail cache: could not store %s: %s\n", cacheKey, err.Error())
+		}
+	}
+
+	log.Printf("Download: %v in changed dimensions -> %vx%v", filename, width, height)
+
+	w.Header().Set("Content-Type", "image/png")
+	httputil.ServeContent(w, r, filename+".png", time.Now(), hash, io.NopCloser(bytes.NewReader(buf.Bytes())))
 }
 
 // Delete
@@ -195,11 +605,17 @@ func deleteHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	filePath := filepath.Join(storageRoot, client, filename)
-	if err := os.Remove(filePath); err != nil {
+	key := objectKey(client, filename)
+	if perm := permissionsFromContext(r); perm != nil && !perm.AllowsKey(key) {
+		http.Error(w, "Forbidden: key does not allow this path", http.StatusForbidden)
+		return
+	}
+
+	if err := storage.Delete(key); err != nil {
 		http.Error(w, "Delete failed: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	metadata.Delete(storage, key)
 
 	log.Printf("Delete: %v", filename)
 
@@ -214,23 +630,167 @@ func listHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	dir := filepath.Join(storageRoot, client)
-	files, err := os.ReadDir(dir)
+	names, err := storage.List(client + "/")
 	if err != nil {
-		http.Error(w, "Cannot read dir: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, "Cannot list files: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	var out []string
-	for _, f := range files {
-		if !f.IsDir() {
-			out = append(out, f.Name())
+	perm := permissionsFromContext(r)
+
+	var out []listEntry
+	for _, name := range names {
+		if metadata.IsSidecarKey(name) {
+			continue
+		}
+
+		if perm != nil && !perm.AllowsKey(objectKey(client, name)) {
+			continue
+		}
+
+		m, err := metadata.Load(storage, objectKey(client, name))
+		if err != nil {
+			out = append(out, listEntry{Name: name})
+			continue
 		}
+
+		out = append(out, listEntry{
+			Name:      name,
+			Size:      m.Size,
+			MimeType:  m.MimeType,
+			SHA256Sum: m.SHA256Sum,
+			ExpiresAt: m.ExpiryUnix,
+		})
 	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(out)
 }
 
+// listEntry is the JSON shape returned by /list for each object.
+type listEntry struct {
+	Name      string `json:"name"`
+	Size      int64  `json:"size"`
+	MimeType  string `json:"mimetype"`
+	SHA256Sum string `json:"sha256"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+// Archive: bundle several (or all) of a client's files into a single
+// streamed zip or tar.gz download.
+func archiveHandler(w http.ResponseWriter, r *http.Request) {
+	client := sanitizeClient(r.URL.Query().Get("client"))
+	if client == "" {
+		http.Error(w, "client required", http.StatusBadRequest)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "zip"
+	}
+	if format != "zip" && format != "tar.gz" {
+		http.Error(w, "format must be zip or tar.gz", http.StatusBadRequest)
+		return
+	}
+
+	var names []string
+	if r.URL.Query().Get("all") == "1" {
+		all, err := storage.List(client + "/")
+		if err != nil {
+			http.Error(w, "Cannot list files: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, name := range all {
+			if !metadata.IsSidecarKey(name) {
+				names = append(names, name)
+			}
+		}
+	} else {
+		filesParam := r.URL.Query().Get("files")
+		if filesParam == "" {
+			http.Error(w, "files or all=1 required", http.StatusBadRequest)
+			return
+		}
+		for _, name := range strings.Split(filesParam, ",") {
+			if name = filepath.Base(strings.TrimSpace(name)); name != "" && !metadata.IsSidecarKey(name) {
+				names = append(names, name)
+			}
+		}
+	}
+
+	perm := permissionsFromContext(r)
+	var allowed []string
+	for _, name := range names {
+		if perm == nil || perm.AllowsKey(objectKey(client, name)) {
+			allowed = append(allowed, name)
+		}
+	}
+	names = allowed
+
+	if len(names) == 0 {
+		http.Error(w, "no files to archive", http.StatusBadRequest)
+		return
+	}
+
+	ext := format
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%d.%s"`, client, time.Now().Unix(), ext))
+
+	if format == "zip" {
+		w.Header().Set("Content-Type", "application/zip")
+		writeZipArchive(w, client, names)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/gzip")
+	writeTarGzArchive(w, client, names)
+}
+
+func writeZipArchive(w http.ResponseWriter, client string, names []string) {
+	zw := zip.NewWriter(w)
+	defer zw.Close()
+
+	for _, name := range names {
+		rc, _, err := storage.Get(objectKey(client, name))
+		if err != nil {
+			log.Printf("Archive: skipping %s: %s\n", name, err.Error())
+			continue
+		}
+
+		entry, err := zw.Create(filepath.Base(name))
+		if err == nil {
+			io.Copy(entry, rc)
+		}
+		rc.Close()
+	}
+}
+
+func writeTarGzArchive(w http.ResponseWriter, client string, names []string) {
+	gw := gzip.NewWriter(w)
+	defer gw.Close()
+	tw := tar.NewWriter(gw)
+	defer tw.Close()
+
+	for _, name := range names {
+		rc, meta, err := storage.Get(objectKey(client, name))
+		if err != nil {
+			log.Printf("Archive: skipping %s: %s\n", name, err.Error())
+			continue
+		}
+
+		header := &tar.Header{
+			Name:    filepath.Base(name),
+			Size:    meta.Size,
+			Mode:    0644,
+			ModTime: meta.ModTime,
+		}
+		if err := tw.WriteHeader(header); err == nil {
+			io.Copy(tw, rc)
+		}
+		rc.Close()
+	}
+}
+
 func presignHandler(w http.ResponseWriter, r *http.Request) {
 	client := sanitizeClient(r.URL.Query().Get("client"))
 	filename := filepath.Base(r.URL.Query().Get("filename"))
@@ -240,17 +800,21 @@ func presignHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	dir := filepath.Join(storageRoot, client)
-	filePath := filepath.Join(dir, filename)
-	expiresAt := time.Now().Add(5 * time.Minute).Unix()
+	key := objectKey(client, filename)
+	if perm := permissionsFromContext(r); perm != nil && !perm.AllowsKey(key) {
+		http.Error(w, "Forbidden: key does not allow this path", http.StatusForbidden)
+		return
+	}
+
+	expiresAt := time.Now().Add(time.Duration(cfg.PresignTTLSeconds) * time.Second).Unix()
 
-	// signature: HMAC(secret, path|expires)
-	mac := hmac.New(sha256.New, []byte(os.Getenv("PRESIGN_SECRET")))
-	mac.Write([]byte(fmt.Sprintf("%s|%d", filePath, expiresAt)))
+	// signature: HMAC(secret, key|expires)
+	mac := hmac.New(sha256.New, []byte(cfg.PresignSecret))
+	mac.Write([]byte(fmt.Sprintf("%s|%d", key, expiresAt)))
 	sig := mac.Sum(nil)
 
 	encodedPayload := base64.URLEncoding.EncodeToString([]byte(
-		fmt.Sprintf("%s|%d|%s", filePath, expiresAt, sig),
+		fmt.Sprintf("%s|%d|%s", key, expiresAt, sig),
 	))
 
 	presignedURL := fmt.Sprintf("/presignedupload?q=%s", encodedPayload)
@@ -269,7 +833,7 @@ func presignedUploadHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	parts := strings.Split(string(q), "|")
-	filePath := parts[0]
+	key := parts[0]
 	expiresStr := parts[1]
 	sigString := parts[2]
 
@@ -280,15 +844,8 @@ func presignedUploadHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	fileContent, err := io.ReadAll(r.Body)
-	if err != nil {
-		log.Printf("Could not read body: %s\n", err.Error())
-		http.Error(w, "Could not read body", http.StatusBadRequest)
-		return
-	}
-
-	mac := hmac.New(sha256.New, []byte(os.Getenv("PRESIGN_SECRET")))
-	mac.Write([]byte(fmt.Sprintf("%s|%d", filePath, expiresAt)))
+	mac := hmac.New(sha256.New, []byte(cfg.PresignSecret))
+	mac.Write([]byte(fmt.Sprintf("%s|%d", key, expiresAt)))
 	expectedSig := mac.Sum(nil)
 	sig := []byte(sigString)
 	if !hmac.Equal([]byte(expectedSig), []byte(sig)) {
@@ -297,39 +854,126 @@ func presignedUploadHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	dir := filepath.Dir(filePath)
-	filename := filepath.Base(filePath)
-	savedFilePath, err := saveFile(dir, filename, fileContent)
-	if err != nil {
+	body, mime, ok := sniffBody(w, r)
+	if !ok {
+		return
+	}
+
+	hash := sha256.New()
+	counting := &countingReader{r: io.TeeReader(body, hash)}
+	if err := storage.Put(key, counting); err != nil {
 		log.Printf("Cannot create file: %s\n", err.Error())
 		http.Error(w, "Cannot create file: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("Upload: %v to %v", filename, dir)
+	deleteKey, err := metadata.NewDeleteKey()
+	if err != nil {
+		http.Error(w, "Cannot generate delete key: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
 
+	client, filename := splitKey(key)
+	m := metadata.Metadata{
+		DeleteKey:      deleteKey,
+		SHA256Sum:      hex.EncodeToString(hash.Sum(nil)),
+		MimeType:       mime.String(),
+		Size:           counting.n,
+		ExpiryUnix:     expiryFromQuery(r),
+		OriginalName:   filename,
+		UploaderClient: client,
+	}
+	if err := metadata.Save(storage, key, m); err != nil {
+		http.Error(w, "Cannot save metadata: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Upload: %v", key)
+
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	fmt.Fprintf(w, `{"message":"uploaded","path":"%s"}`, savedFilePath)
+	json.NewEncoder(w).Encode(m)
+}
+
+// splitKey splits an object key of the form "<client>/<filename>" back
+// into its two parts.
+func splitKey(key string) (client, filename string) {
+	idx := strings.LastIndex(key, "/")
+	if idx < 0 {
+		return "", key
+	}
+	return key[:idx], key[idx+1:]
+}
+
+// runExpirySweeper periodically removes objects past their metadata expiry.
+func runExpirySweeper() {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		users, err := db.AllUsers()
+		if err != nil {
+			log.Printf("Sweeper: cannot list clients: %s\n", err.Error())
+			continue
+		}
+
+		seen := make(map[string]bool, len(users))
+		var clients []string
+		for _, u := range users {
+			if !seen[u.ClientId] {
+				seen[u.ClientId] = true
+				clients = append(clients, u.ClientId)
+			}
+		}
+
+		removed, err := metadata.Sweep(storage, clients, time.Now())
+		if err != nil {
+			log.Printf("Sweeper: error: %s\n", err.Error())
+			continue
+		}
+		if removed > 0 {
+			log.Printf("Sweeper: removed %d expired file(s)", removed)
+		}
+
+		thumbsRemoved, err := sweepThumbnails(storage, time.Now())
+		if err != nil {
+			log.Printf("Sweeper: thumbnail cache error: %s\n", err.Error())
+			continue
+		}
+		if thumbsRemoved > 0 {
+			log.Printf("Sweeper: removed %d stale thumbnail(s)", thumbsRemoved)
+		}
+	}
 }
 
 func main() {
-	db.InitDB()
+	var err error
+	cfg, err = config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db.InitDB(cfg.DBPath)
 	defer db.Close()
 
+	storage, err = newStorageBackend(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	go runExpirySweeper()
+
 	mux := http.NewServeMux()
-	mux.Handle("/upload", withAuthAndCORS(http.HandlerFunc(uploadHandler)))
-	mux.Handle("/delete", withAuthAndCORS(http.HandlerFunc(deleteHandler)))
-	mux.Handle("/list", withAuthAndCORS(http.HandlerFunc(listHandler)))
-	mux.Handle("/presignurl", withAuthAndCORS(http.HandlerFunc(presignHandler)))
+	mux.Handle("/upload", withAuthAndCORS(db.OpUpload, http.HandlerFunc(uploadHandler)))
+	mux.Handle("/upload/pomf", withAuthAndCORS(db.OpUpload, http.HandlerFunc(pomfUploadHandler)))
+	mux.Handle("/delete", withDeleteAuthAndCORS(http.HandlerFunc(deleteHandler)))
+	mux.Handle("/list", withAuthAndCORS(db.OpList, http.HandlerFunc(listHandler)))
+	mux.Handle("/archive", withAuthAndCORS(db.OpList, http.HandlerFunc(archiveHandler)))
+	mux.Handle("/presignurl", withAuthAndCORS(db.OpPresign, http.HandlerFunc(presignHandler)))
 
 	mux.Handle("/download", withPublicCORS(http.HandlerFunc(downloadHandler)))
 	mux.Handle("/presignedupload", withPublicCORS(http.HandlerFunc(presignedUploadHandler)))
 
-	port := "8888"
-	if p, exists := os.LookupEnv("HANDRADI_PORT"); exists {
-		port = p
-	}
-
-	log.Printf("ðŸ“¦ File server running on :%v", port)
-	log.Fatal(http.ListenAndServe(":"+port, mux))
+	log.Printf("ðŸ“¦ File server running on :%v", cfg.Port)
+	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", cfg.Port), mux))
 }
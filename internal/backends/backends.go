@@ -0,0 +1,51 @@
+// Package backends defines the storage abstraction used by the HTTP
+// handlers so that uploads can be served from the local filesystem, S3,
+// or any other object store without touching handler code.
+package backends
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"time"
+)
+
+// ErrNotExist is returned by Get/Delete when the requested key does not
+// exist in the backend.
+var ErrNotExist = errors.New("backends: key does not exist")
+
+// Metadata describes the handful of file attributes handlers need in
+// order to answer a request without reading the whole object.
+type Metadata struct {
+	Size        int64
+	ModTime     time.Time
+	ContentType string
+}
+
+// StorageBackend is implemented by every storage driver (localfs, s3, ...).
+// Keys are slash-separated paths such as "<client>/<filename>"; backends
+// are responsible for mapping that onto whatever namespacing they use
+// internally (a directory tree, a bucket prefix, ...).
+type StorageBackend interface {
+	// Put stores the contents of r under key, overwriting any existing
+	// object.
+	Put(key string, r io.Reader) error
+
+	// Get opens the object stored under key. Callers must close the
+	// returned ReadCloser.
+	Get(key string) (io.ReadCloser, Metadata, error)
+
+	// Delete removes the object stored under key.
+	Delete(key string) error
+
+	// List returns the names of the objects stored under prefix, relative
+	// to prefix (so listing "<client>/" yields bare filenames).
+	List(prefix string) ([]string, error)
+
+	// Exists reports whether key is present in the backend.
+	Exists(key string) (bool, error)
+
+	// ServeFile writes the object stored under key to w, honoring
+	// whatever conditional/range semantics the backend supports.
+	ServeFile(w http.ResponseWriter, r *http.Request, key string)
+}
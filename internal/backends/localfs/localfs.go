@@ -0,0 +1,106 @@
+// Package localfs implements backends.StorageBackend on top of the local
+// filesystem, keeping the historical "./storage/<client>/<file>" layout.
+package localfs
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/ivar1309/Handradi/internal/backends"
+)
+
+// Backend stores objects as files under Root, creating parent
+// directories on demand.
+type Backend struct {
+	Root string
+}
+
+// New returns a Backend rooted at root.
+func New(root string) *Backend {
+	return &Backend{Root: root}
+}
+
+func (b *Backend) path(key string) string {
+	return filepath.Join(b.Root, filepath.FromSlash(key))
+}
+
+func (b *Backend) Put(key string, r io.Reader) error {
+	path := b.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, r)
+	return err
+}
+
+func (b *Backend) Get(key string) (io.ReadCloser, backends.Metadata, error) {
+	path := b.path(key)
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, backends.Metadata{}, backends.ErrNotExist
+		}
+		return nil, backends.Metadata{}, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, backends.Metadata{}, err
+	}
+
+	return f, backends.Metadata{Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+func (b *Backend) Delete(key string) error {
+	if err := os.Remove(b.path(key)); err != nil {
+		if os.IsNotExist(err) {
+			return backends.ErrNotExist
+		}
+		return err
+	}
+	return nil
+}
+
+func (b *Backend) List(prefix string) ([]string, error) {
+	dir := b.path(prefix)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var out []string
+	for _, e := range entries {
+		if !e.IsDir() {
+			out = append(out, e.Name())
+		}
+	}
+	return out, nil
+}
+
+func (b *Backend) Exists(key string) (bool, error) {
+	_, err := os.Stat(b.path(key))
+	if err == nil {
+		return true, nil
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return false, err
+}
+
+func (b *Backend) ServeFile(w http.ResponseWriter, r *http.Request, key string) {
+	http.ServeFile(w, r, b.path(key))
+}
@@ -0,0 +1,155 @@
+// Package s3 implements backends.StorageBackend on top of any S3-compatible
+// object store (AWS S3, MinIO, ...) via the minio-go client.
+package s3
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+
+	"github.com/ivar1309/Handradi/internal/backends"
+)
+
+// Backend stores objects as keys in a single S3 bucket.
+type Backend struct {
+	client *minio.Client
+	bucket string
+}
+
+// Config holds the connection details read from the environment.
+type Config struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	UseSSL    bool
+}
+
+// ConfigFromEnv reads HANDRADI_S3_* environment variables into a Config.
+func ConfigFromEnv() Config {
+	return Config{
+		Endpoint:  os.Getenv("HANDRADI_S3_ENDPOINT"),
+		Region:    os.Getenv("HANDRADI_S3_REGION"),
+		Bucket:    os.Getenv("HANDRADI_S3_BUCKET"),
+		AccessKey: os.Getenv("HANDRADI_S3_ACCESS_KEY"),
+		SecretKey: os.Getenv("HANDRADI_S3_SECRET_KEY"),
+		UseSSL:    os.Getenv("HANDRADI_S3_USE_SSL") != "false",
+	}
+}
+
+// New creates a Backend from cfg, creating the bucket if it doesn't exist yet.
+func New(cfg Config) (*Backend, error) {
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: cfg.UseSSL,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	exists, err := client.BucketExists(ctx, cfg.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		if err := client.MakeBucket(ctx, cfg.Bucket, minio.MakeBucketOptions{Region: cfg.Region}); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Backend{client: client, bucket: cfg.Bucket}, nil
+}
+
+func (b *Backend) Put(key string, r io.Reader) error {
+	_, err := b.client.PutObject(context.Background(), b.bucket, key, r, -1, minio.PutObjectOptions{})
+	return err
+}
+
+func (b *Backend) Get(key string) (io.ReadCloser, backends.Metadata, error) {
+	ctx := context.Background()
+	obj, err := b.client.GetObject(ctx, b.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, backends.Metadata{}, err
+	}
+
+	info, err := obj.Stat()
+	if err != nil {
+		obj.Close()
+		if isNotFound(err) {
+			return nil, backends.Metadata{}, backends.ErrNotExist
+		}
+		return nil, backends.Metadata{}, err
+	}
+
+	return obj, backends.Metadata{
+		Size:        info.Size,
+		ModTime:     info.LastModified,
+		ContentType: info.ContentType,
+	}, nil
+}
+
+func (b *Backend) Delete(key string) error {
+	err := b.client.RemoveObject(context.Background(), b.bucket, key, minio.RemoveObjectOptions{})
+	if isNotFound(err) {
+		return backends.ErrNotExist
+	}
+	return err
+}
+
+func (b *Backend) List(prefix string) ([]string, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var out []string
+	for obj := range b.client.ListObjects(ctx, b.bucket, minio.ListObjectsOptions{Prefix: prefix}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		out = append(out, strings.TrimPrefix(obj.Key, prefix))
+	}
+	return out, nil
+}
+
+func (b *Backend) Exists(key string) (bool, error) {
+	_, err := b.client.StatObject(context.Background(), b.bucket, key, minio.StatObjectOptions{})
+	if err == nil {
+		return true, nil
+	}
+	if isNotFound(err) {
+		return false, nil
+	}
+	return false, err
+}
+
+// ServeFile streams the object to w. Range and conditional-GET headers are
+// not yet honored here; see httputil for that layer.
+func (b *Backend) ServeFile(w http.ResponseWriter, r *http.Request, key string) {
+	rc, meta, err := b.Get(key)
+	if err != nil {
+		if err == backends.ErrNotExist {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, "Cannot read object: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rc.Close()
+
+	if meta.ContentType != "" {
+		w.Header().Set("Content-Type", meta.ContentType)
+	}
+	io.Copy(w, rc)
+}
+
+func isNotFound(err error) bool {
+	resp := minio.ToErrorResponse(err)
+	return resp.Code == "NoSuchKey" || resp.Code == "NotFound"
+}
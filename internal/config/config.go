@@ -0,0 +1,111 @@
+// Package config loads Handradi's runtime configuration from a JSON file
+// (selected with -config or HANDRADI_CONFIG) or, failing that, from
+// individual environment variables, so the server is deployable without
+// recompiling.
+package config
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Config holds every tunable the server previously read from package-level
+// globals or ad-hoc os.Getenv calls.
+type Config struct {
+	Port              int      `json:"port"`
+	StorageRoot       string   `json:"storage_root"`
+	Backend           string   `json:"backend"`
+	PresignSecret     string   `json:"presign_secret"`
+	PresignTTLSeconds int      `json:"presign_ttl_seconds"`
+	DBPath            string   `json:"db_path"`
+	MaxUploadBytes    int64    `json:"max_upload_bytes"`
+	AllowedMIMETypes  []string `json:"allowed_mime_types"`
+	TrustProxyHeaders bool     `json:"trust_proxy_headers"`
+	EnableMetrics     bool     `json:"enable_metrics"`
+}
+
+func defaults() Config {
+	return Config{
+		Port:              8888,
+		StorageRoot:       "./storage",
+		Backend:           "localfs",
+		PresignSecret:     "",
+		PresignTTLSeconds: 300,
+		DBPath:            "./clients/clients.db",
+		MaxUploadBytes:    0,
+		AllowedMIMETypes:  nil,
+		TrustProxyHeaders: false,
+		EnableMetrics:     false,
+	}
+}
+
+// Load resolves the config path from -config or HANDRADI_CONFIG and reads
+// it; if neither is set it builds the config from individual environment
+// variables, falling back to defaults for anything unset.
+func Load() (*Config, error) {
+	path := os.Getenv("HANDRADI_CONFIG")
+
+	fs := flag.NewFlagSet("handradi", flag.ContinueOnError)
+	fs.StringVar(&path, "config", path, "path to a JSON config file")
+	if err := fs.Parse(os.Args[1:]); err != nil {
+		return nil, err
+	}
+
+	cfg := defaults()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return nil, err
+		}
+		return &cfg, nil
+	}
+
+	applyEnvOverrides(&cfg)
+	return &cfg, nil
+}
+
+func applyEnvOverrides(cfg *Config) {
+	if v, ok := os.LookupEnv("HANDRADI_PORT"); ok {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.Port = n
+		}
+	}
+	if v, ok := os.LookupEnv("HANDRADI_STORAGE_ROOT"); ok {
+		cfg.StorageRoot = v
+	}
+	if v, ok := os.LookupEnv("HANDRADI_BACKEND"); ok {
+		cfg.Backend = v
+	}
+	if v, ok := os.LookupEnv("PRESIGN_SECRET"); ok {
+		cfg.PresignSecret = v
+	}
+	if v, ok := os.LookupEnv("HANDRADI_PRESIGN_TTL_SECONDS"); ok {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.PresignTTLSeconds = n
+		}
+	}
+	if v, ok := os.LookupEnv("HANDRADI_DB_PATH"); ok {
+		cfg.DBPath = v
+	}
+	if v, ok := os.LookupEnv("HANDRADI_MAX_UPLOAD_BYTES"); ok {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			cfg.MaxUploadBytes = n
+		}
+	}
+	if v, ok := os.LookupEnv("HANDRADI_ALLOWED_MIME_TYPES"); ok {
+		cfg.AllowedMIMETypes = strings.Split(v, ",")
+	}
+	if v, ok := os.LookupEnv("HANDRADI_TRUST_PROXY_HEADERS"); ok {
+		cfg.TrustProxyHeaders = v == "true"
+	}
+	if v, ok := os.LookupEnv("HANDRADI_ENABLE_METRICS"); ok {
+		cfg.EnableMetrics = v == "true"
+	}
+}
@@ -1,55 +1,190 @@
 package db
 
 import (
+	"crypto/rand"
 	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
 
 	_ "modernc.org/sqlite"
 )
 
 var DB *sql.DB
 
+// Operation is a single bit in the scope bitmask stored against an API key.
+type Operation int
+
+const (
+	OpUpload Operation = 1 << iota
+	// OpDownload is accepted by ParseScopes and "cli key create --scopes"
+	// for forward compatibility, but /download is served without auth by
+	// design (uploaded files get a shareable public link) and never
+	// consults it. Granting or withholding this scope has no effect.
+	OpDownload
+	OpDelete
+	OpList
+	OpPresign
+)
+
+// AllOperations is the scope granted to keys created by AddUser, matching
+// today's single all-powerful key per client.
+const AllOperations = OpUpload | OpDownload | OpDelete | OpList | OpPresign
+
+var operationNames = map[string]Operation{
+	"upload":   OpUpload,
+	"download": OpDownload,
+	"delete":   OpDelete,
+	"list":     OpList,
+	"presign":  OpPresign,
+}
+
+// ParseScopes parses a comma-separated scope list such as
+// "upload,list,presign" into an Operation bitmask.
+func ParseScopes(s string) (Operation, error) {
+	var scopes Operation
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		op, ok := operationNames[name]
+		if !ok {
+			return 0, fmt.Errorf("unknown scope %q", name)
+		}
+		scopes |= op
+	}
+	return scopes, nil
+}
+
+// User is a row in the clients table: one API key belonging to a client,
+// with the permissions it was granted.
 type User struct {
 	ClientId      string
 	ApiKey        string
 	AllowedOrigin string
+	Scopes        Operation
+	Prefix        string
+	ParentKey     string
+	ExpiresAt     int64
+}
+
+// Permissions is what CheckAuth hands back to the HTTP layer so handlers
+// can enforce least privilege per request.
+type Permissions struct {
+	ClientID      string
+	AllowedOrigin string
+	Scopes        Operation
+	Prefix        string
+	ExpiresAt     int64
+}
+
+// Allows reports whether these permissions grant op and have not expired.
+func (p *Permissions) Allows(op Operation) bool {
+	if p.ExpiresAt != 0 && time.Now().Unix() > p.ExpiresAt {
+		return false
+	}
+	return p.Scopes&op != 0
+}
+
+// AllowsKey reports whether key falls under this key's prefix restriction.
+// An empty Prefix means no restriction.
+func (p *Permissions) AllowsKey(key string) bool {
+	return p.Prefix == "" || strings.HasPrefix(key, p.Prefix)
 }
 
-func InitDB() {
+func InitDB(path string) {
 	var err error
-	DB, err = sql.Open("sqlite", "./clients/clients.db")
+	DB, err = sql.Open("sqlite", path)
 	if err != nil {
 		panic(err)
 	}
 	_, err = DB.Exec(`
 		CREATE TABLE IF NOT EXISTS clients (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			client_id TEXT UNIQUE NOT NULL,
-			api_key TEXT NOT NULL,
-			allowed_origin TEXT
+			client_id TEXT NOT NULL,
+			api_key TEXT UNIQUE NOT NULL,
+			allowed_origin TEXT,
+			scopes INTEGER NOT NULL DEFAULT 31,
+			prefix TEXT NOT NULL DEFAULT '',
+			parent_key TEXT NOT NULL DEFAULT '',
+			expires_at INTEGER NOT NULL DEFAULT 0
 		)`,
 	)
 
 	if err != nil {
 		panic(err)
 	}
+
+	if err := migrateClientsTable(); err != nil {
+		panic(err)
+	}
+}
+
+// migrateClientsTable adds the scopes/prefix/parent_key/expires_at columns
+// to a clients table left behind by a pre-chunk0-3 binary. CREATE TABLE IF
+// NOT EXISTS only applies the new schema to a brand-new database; without
+// this, CheckAuth's SELECT fails with "no such column: scopes" against any
+// clients.db that predates scoped keys.
+func migrateClientsTable() error {
+	rows, err := DB.Query(`PRAGMA table_info(clients)`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var cid, notnull, pk int
+		var name, ctype string
+		var dflt sql.NullString
+		if err := rows.Scan(&cid, &name, &ctype, &notnull, &dflt, &pk); err != nil {
+			return err
+		}
+		existing[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, m := range []struct{ column, ddl string }{
+		{"scopes", "ALTER TABLE clients ADD COLUMN scopes INTEGER NOT NULL DEFAULT 31"},
+		{"prefix", "ALTER TABLE clients ADD COLUMN prefix TEXT NOT NULL DEFAULT ''"},
+		{"parent_key", "ALTER TABLE clients ADD COLUMN parent_key TEXT NOT NULL DEFAULT ''"},
+		{"expires_at", "ALTER TABLE clients ADD COLUMN expires_at INTEGER NOT NULL DEFAULT 0"},
+	} {
+		if existing[m.column] {
+			continue
+		}
+		if _, err := DB.Exec(m.ddl); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 func Close() {
 	DB.Close()
 }
 
-func CheckAuth(clientID, apiKey string) (string, error) {
-	var allowedOrigin string
+func CheckAuth(clientID, apiKey string) (*Permissions, error) {
+	var perm Permissions
 	err := DB.QueryRow(
-		`SELECT allowed_origin FROM clients WHERE client_id = ? AND api_key = ?`,
+		`SELECT client_id, allowed_origin, scopes, prefix, expires_at FROM clients WHERE client_id = ? AND api_key = ?`,
 		clientID, apiKey,
-	).Scan(&allowedOrigin)
+	).Scan(&perm.ClientID, &perm.AllowedOrigin, &perm.Scopes, &perm.Prefix, &perm.ExpiresAt)
 
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return allowedOrigin, nil
+	if perm.ExpiresAt != 0 && time.Now().Unix() > perm.ExpiresAt {
+		return nil, fmt.Errorf("api key expired")
+	}
+
+	return &perm, nil
 }
 
 func CheckOrigin(clientID string) (string, error) {
@@ -68,9 +203,9 @@ func CheckOrigin(clientID string) (string, error) {
 
 func AddUser(clientID, apiKey, origin string) error {
 	_, err := DB.Exec(`
-		INSERT INTO clients (client_id, api_key, allowed_origin) 
-		VALUES (?, ?, ?)`,
-		clientID, apiKey, origin)
+		INSERT INTO clients (client_id, api_key, allowed_origin, scopes, prefix, parent_key, expires_at)
+		VALUES (?, ?, ?, ?, '', '', 0)`,
+		clientID, apiKey, origin, AllOperations)
 
 	if err != nil {
 		return err
@@ -79,8 +214,125 @@ func AddUser(clientID, apiKey, origin string) error {
 	return nil
 }
 
+// CreateScopedKey derives a new, least-privilege API key for clientID from
+// parentKey, restricted to scopes and (optionally) to keys under prefix,
+// expiring at expiresAt (zero means never). If parentKey is set, the new
+// key's scopes and prefix must fall within the parent's — a derived key can
+// only narrow what its parent is allowed to do, never widen it.
+func CreateScopedKey(clientID, parentKey string, scopes Operation, prefix string, expiresAt time.Time) (string, error) {
+	origin, err := CheckOrigin(clientID)
+	if err != nil {
+		return "", fmt.Errorf("unknown client %q: %w", clientID, err)
+	}
+
+	if parentKey != "" {
+		parent, err := lookupKey(parentKey)
+		if err != nil {
+			return "", fmt.Errorf("unknown parent key: %w", err)
+		}
+		if parent.ClientId != clientID {
+			return "", fmt.Errorf("parent key does not belong to client %q", clientID)
+		}
+		if scopes&^parent.Scopes != 0 {
+			return "", fmt.Errorf("requested scopes exceed parent key's scopes")
+		}
+		if parent.Prefix != "" && !strings.HasPrefix(prefix, parent.Prefix) {
+			return "", fmt.Errorf("requested prefix %q is not under parent key's prefix %q", prefix, parent.Prefix)
+		}
+	}
+
+	apiKey, err := randomAPIKey()
+	if err != nil {
+		return "", err
+	}
+
+	var expiresUnix int64
+	if !expiresAt.IsZero() {
+		expiresUnix = expiresAt.Unix()
+	}
+
+	_, err = DB.Exec(`
+		INSERT INTO clients (client_id, api_key, allowed_origin, scopes, prefix, parent_key, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		clientID, apiKey, origin, scopes, prefix, parentKey, expiresUnix)
+	if err != nil {
+		return "", err
+	}
+
+	return apiKey, nil
+}
+
+func randomAPIKey() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// lookupKey returns the row for apiKey, used to validate a child key's
+// scopes/prefix against its parent in CreateScopedKey.
+func lookupKey(apiKey string) (*User, error) {
+	var u User
+	err := DB.QueryRow(
+		`SELECT client_id, api_key, allowed_origin, scopes, prefix, parent_key, expires_at FROM clients WHERE api_key = ?`,
+		apiKey,
+	).Scan(&u.ClientId, &u.ApiKey, &u.AllowedOrigin, &u.Scopes, &u.Prefix, &u.ParentKey, &u.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// childKeys returns the api_keys of every row directly derived from
+// parentKey via CreateScopedKey.
+func childKeys(parentKey string) ([]string, error) {
+	rows, err := DB.Query("SELECT api_key FROM clients WHERE parent_key = ?", parentKey)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var k string
+		if err := rows.Scan(&k); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// RevokeKey deletes apiKey and every key transitively derived from it, so
+// revoking a parent key also invalidates the children it was used to create.
+func RevokeKey(apiKey string) error {
+	toRevoke := []string{apiKey}
+	seen := map[string]bool{apiKey: true}
+
+	for i := 0; i < len(toRevoke); i++ {
+		children, err := childKeys(toRevoke[i])
+		if err != nil {
+			return err
+		}
+		for _, c := range children {
+			if !seen[c] {
+				seen[c] = true
+				toRevoke = append(toRevoke, c)
+			}
+		}
+	}
+
+	for _, k := range toRevoke {
+		if _, err := DB.Exec("DELETE FROM clients WHERE api_key = ?", k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func AllUsers() ([]User, error) {
-	rows, err := DB.Query("SELECT client_id, api_key, allowed_origin FROM clients")
+	rows, err := DB.Query("SELECT client_id, api_key, allowed_origin, scopes, prefix, parent_key, expires_at FROM clients")
 	if err != nil {
 		return nil, err
 	}
@@ -89,13 +341,14 @@ func AllUsers() ([]User, error) {
 	var users []User
 	for rows.Next() {
 		var user User
-		rows.Scan(&user.ClientId, &user.ApiKey, &user.AllowedOrigin)
+		rows.Scan(&user.ClientId, &user.ApiKey, &user.AllowedOrigin, &user.Scopes, &user.Prefix, &user.ParentKey, &user.ExpiresAt)
 		users = append(users, user)
 	}
 
 	return users, nil
 }
 
+// DeleteUser removes every key (root and scoped) belonging to clientID.
 func DeleteUser(clientID string) error {
 	_, err := DB.Exec("DELETE FROM clients WHERE client_id = ?", clientID)
 	if err != nil {
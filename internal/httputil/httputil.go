@@ -0,0 +1,39 @@
+// Package httputil adds the conditional-GET and Range support that
+// http.ServeFile gets for free on local files, but which our StorageBackend
+// abstraction (and remote backends like S3) doesn't otherwise provide.
+package httputil
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"time"
+)
+
+// ServeContent writes rc to w, honoring If-None-Match/If-Modified-Since
+// (replying 304 Not Modified when appropriate) and Range requests
+// (replying 206 Partial Content). sha is used as the ETag and should
+// uniquely identify the content (e.g. its sha256 checksum). rc is always
+// closed before ServeContent returns.
+//
+// If rc does not implement io.Seeker (as required to serve Range
+// requests), its contents are buffered into memory first.
+func ServeContent(w http.ResponseWriter, r *http.Request, name string, modTime time.Time, sha string, rc io.ReadCloser) {
+	defer rc.Close()
+
+	rs, ok := rc.(io.ReadSeeker)
+	if !ok {
+		b, err := io.ReadAll(rc)
+		if err != nil {
+			http.Error(w, "Cannot read content: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		rs = bytes.NewReader(b)
+	}
+
+	if sha != "" {
+		w.Header().Set("ETag", `"`+sha+`"`)
+	}
+
+	http.ServeContent(w, r, name, modTime, rs)
+}
@@ -0,0 +1,122 @@
+// Package metadata stores a small JSON sidecar alongside every uploaded
+// object, giving each file a delete key, an integrity checksum, and an
+// optional expiry that the TTL sweeper can act on.
+package metadata
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/ivar1309/Handradi/internal/backends"
+)
+
+const sidecarSuffix = ".meta.json"
+
+// Metadata is the JSON sidecar written for every uploaded object.
+type Metadata struct {
+	DeleteKey      string `json:"delete_key"`
+	SHA256Sum      string `json:"sha256sum"`
+	MimeType       string `json:"mimetype"`
+	Size           int64  `json:"size"`
+	ExpiryUnix     int64  `json:"expiry_unix"`
+	OriginalName   string `json:"original_name"`
+	UploaderClient string `json:"uploader_client"`
+}
+
+// Expired reports whether m has a non-zero expiry that has passed.
+func (m Metadata) Expired(now time.Time) bool {
+	return m.ExpiryUnix != 0 && now.Unix() >= m.ExpiryUnix
+}
+
+// SidecarKey returns the storage key used for the metadata sidecar of key.
+func SidecarKey(key string) string {
+	return key + sidecarSuffix
+}
+
+// IsSidecarKey reports whether key names a metadata sidecar rather than
+// an uploaded object.
+func IsSidecarKey(key string) bool {
+	return strings.HasSuffix(key, sidecarSuffix)
+}
+
+// NewDeleteKey returns a random, URL-safe delete key.
+func NewDeleteKey() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// Save writes m as the metadata sidecar for key.
+func Save(storage backends.StorageBackend, key string, m Metadata) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return storage.Put(SidecarKey(key), bytes.NewReader(b))
+}
+
+// Load reads the metadata sidecar for key.
+func Load(storage backends.StorageBackend, key string) (Metadata, error) {
+	rc, _, err := storage.Get(SidecarKey(key))
+	if err != nil {
+		return Metadata{}, err
+	}
+	defer rc.Close()
+
+	var m Metadata
+	if err := json.NewDecoder(rc).Decode(&m); err != nil {
+		return Metadata{}, err
+	}
+	return m, nil
+}
+
+// Delete removes the metadata sidecar for key, if any.
+func Delete(storage backends.StorageBackend, key string) error {
+	err := storage.Delete(SidecarKey(key))
+	if err == backends.ErrNotExist {
+		return nil
+	}
+	return err
+}
+
+// Sweep scans every key listed under prefix for each client and removes
+// objects (and their sidecars) whose metadata has expired. It returns the
+// number of objects removed.
+func Sweep(storage backends.StorageBackend, clients []string, now time.Time) (int, error) {
+	removed := 0
+	for _, client := range clients {
+		keys, err := storage.List(client + "/")
+		if err != nil {
+			return removed, err
+		}
+
+		for _, name := range keys {
+			if IsSidecarKey(name) {
+				continue
+			}
+
+			key := client + "/" + name
+			m, err := Load(storage, key)
+			if err != nil {
+				continue
+			}
+
+			if !m.Expired(now) {
+				continue
+			}
+
+			if err := storage.Delete(key); err != nil {
+				continue
+			}
+			Delete(storage, key)
+			removed++
+		}
+	}
+	return removed, nil
+}